@@ -17,17 +17,27 @@ limitations under the License.
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"hash/fnv"
 	"os"
+	"sort"
+	"strings"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	"golang.org/x/time/rate"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
@@ -41,6 +51,16 @@ var (
 	setupLog = ctrl.Log.WithName("setup")
 )
 
+const leaderElectionID = "f139389e.kuadrant.io"
+
+// Requeue rate limiter defaults, matching workqueue.DefaultControllerRateLimiter.
+const (
+	defaultRequeueBaseDelay = 5 * time.Millisecond
+	defaultRequeueMaxDelay  = 1000 * time.Second
+	defaultRequeueQPS       = 10
+	defaultRequeueBurst     = 100
+)
+
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 
@@ -51,12 +71,40 @@ func init() {
 func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
+	var leaseDuration, renewDeadline, retryPeriod time.Duration
+	var watchNamespaces string
+	var maxConcurrentReconciles int
+	var requeueBaseDelay, requeueMaxDelay time.Duration
+	var requeueQPS float64
+	var requeueBurst int
 	var probeAddr string
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.DurationVar(&leaseDuration, "leader-elect-lease-duration", 15*time.Second,
+		"The duration that non-leader candidates will wait to force acquire leadership.")
+	flag.DurationVar(&renewDeadline, "leader-elect-renew-deadline", 10*time.Second,
+		"The duration that the acting leader will retry refreshing leadership before giving up.")
+	flag.DurationVar(&retryPeriod, "leader-elect-retry-period", 2*time.Second,
+		"The duration the leader election clients should wait between tries of actions.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma separated list of namespaces the controller manager watches. Defaults to all namespaces. "+
+			"Replicas watching different namespaces elect a leader per set of namespaces, "+
+			"which allows sharding large clusters across several controller managers. "+
+			"The namespace sets of the shards must be disjoint and must not be combined with "+
+			"a replica watching all namespaces, otherwise shared namespaces are reconciled concurrently.")
+	flag.IntVar(&maxConcurrentReconciles, "kuadrant-max-concurrent-reconciles", 1,
+		"The maximum number of concurrent reconciles of the Kuadrant controller.")
+	flag.DurationVar(&requeueBaseDelay, "requeue-base-delay", defaultRequeueBaseDelay,
+		"The initial delay of the exponential backoff applied to failed reconciles.")
+	flag.DurationVar(&requeueMaxDelay, "requeue-max-delay", defaultRequeueMaxDelay,
+		"The maximum delay of the exponential backoff applied to failed reconciles.")
+	flag.Float64Var(&requeueQPS, "requeue-qps", defaultRequeueQPS,
+		"The overall rate of requeues per second allowed per controller.")
+	flag.IntVar(&requeueBurst, "requeue-burst", defaultRequeueBurst,
+		"The maximum number of requeues allowed at once per controller (token bucket size).")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -65,22 +113,48 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
-	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
+	if enableLeaderElection {
+		if err := validateLeaderElection(leaseDuration, renewDeadline, retryPeriod); err != nil {
+			setupLog.Error(err, "invalid leader election flags")
+			os.Exit(1)
+		}
+	}
+
+	if err := validateRateLimiter(requeueBaseDelay, requeueMaxDelay, requeueQPS, requeueBurst); err != nil {
+		setupLog.Error(err, "invalid requeue rate limiter flags")
+		os.Exit(1)
+	}
+
+	namespaces := parseNamespaces(watchNamespaces)
+
+	options := ctrl.Options{
 		Scheme:                 scheme,
 		MetricsBindAddress:     metricsAddr,
 		Port:                   9443,
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
-		LeaderElectionID:       "f139389e.kuadrant.io",
-	})
+		LeaderElectionID:       shardLeaderElectionID(namespaces),
+		LeaseDuration:          &leaseDuration,
+		RenewDeadline:          &renewDeadline,
+		RetryPeriod:            &retryPeriod,
+	}
+	if len(namespaces) == 1 {
+		options.Namespace = namespaces[0]
+	} else if len(namespaces) > 1 {
+		options.NewCache = cache.MultiNamespacedCacheBuilder(namespaces)
+	}
+
+	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), options)
 	if err != nil {
 		setupLog.Error(err, "unable to start manager")
 		os.Exit(1)
 	}
 
 	if err = (&controllers.KuadrantReconciler{
-		Client: mgr.GetClient(),
-		Scheme: mgr.GetScheme(),
+		Client:                  mgr.GetClient(),
+		Scheme:                  mgr.GetScheme(),
+		MaxConcurrentReconciles: maxConcurrentReconciles,
+		RateLimiter:             newRateLimiter(requeueBaseDelay, requeueMaxDelay, requeueQPS, requeueBurst),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Kuadrant")
 		os.Exit(1)
@@ -96,9 +170,85 @@ func main() {
 		os.Exit(1)
 	}
 
-	setupLog.Info("starting manager")
+	setupLog.Info("starting manager", "namespaces", namespaces,
+		"leaderElection", enableLeaderElection, "leaderElectionID", options.LeaderElectionID)
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		setupLog.Error(err, "problem running manager")
 		os.Exit(1)
 	}
 }
+
+// newRateLimiter returns a requeue rate limiter combining a per-item
+// exponential backoff with an overall token bucket, like the
+// controller-runtime default but with configurable values.
+// Each controller must get its own instance.
+func newRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		workqueue.NewItemExponentialFailureRateLimiter(baseDelay, maxDelay),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
+}
+
+// validateRateLimiter checks the requeue rate limiter settings. A burst below
+// one would make the token bucket delay every requeue indefinitely.
+func validateRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) error {
+	if qps <= 0 {
+		return fmt.Errorf("requeue qps (%v) must be positive", qps)
+	}
+	if burst < 1 {
+		return fmt.Errorf("requeue burst (%d) must be at least 1", burst)
+	}
+	if baseDelay <= 0 {
+		return fmt.Errorf("requeue base delay (%s) must be positive", baseDelay)
+	}
+	if baseDelay > maxDelay {
+		return fmt.Errorf("requeue base delay (%s) must not be greater than max delay (%s)", baseDelay, maxDelay)
+	}
+	return nil
+}
+
+// validateLeaderElection checks the leader election timings the same way the
+// leader elector does, so that a bad combination fails at setup instead of
+// once the manager has started.
+func validateLeaderElection(leaseDuration, renewDeadline, retryPeriod time.Duration) error {
+	if leaseDuration <= 0 || renewDeadline <= 0 || retryPeriod <= 0 {
+		return errors.New("lease duration, renew deadline and retry period must be positive")
+	}
+	if leaseDuration <= renewDeadline {
+		return fmt.Errorf("lease duration (%s) must be greater than renew deadline (%s)", leaseDuration, renewDeadline)
+	}
+	if renewDeadline <= time.Duration(leaderelection.JitterFactor*float64(retryPeriod)) {
+		return fmt.Errorf("renew deadline (%s) must be greater than %v times the retry period (%s)",
+			renewDeadline, leaderelection.JitterFactor, retryPeriod)
+	}
+	return nil
+}
+
+// parseNamespaces splits a comma separated list of namespaces,
+// dropping empty entries and duplicates. The result is sorted.
+func parseNamespaces(value string) []string {
+	seen := map[string]bool{}
+	namespaces := []string{}
+	for _, ns := range strings.Split(value, ",") {
+		ns = strings.TrimSpace(ns)
+		if ns == "" || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// shardLeaderElectionID returns the leader election ID for the given set of
+// watched namespaces, so that each shard elects its own leader.
+// Watching all namespaces keeps the default ID.
+func shardLeaderElectionID(namespaces []string) string {
+	if len(namespaces) == 0 {
+		return leaderElectionID
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(strings.Join(namespaces, ",")))
+	return fmt.Sprintf("%08x.%s", h.Sum32(), leaderElectionID)
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2021.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func TestParseNamespaces(t *testing.T) {
+	cases := []struct {
+		name     string
+		value    string
+		expected []string
+	}{
+		{"empty", "", []string{}},
+		{"blank entries", " , ,", []string{}},
+		{"single", "ns1", []string{"ns1"}},
+		{"whitespace", " ns1 , ns2 ", []string{"ns1", "ns2"}},
+		{"duplicates", "ns1,ns2,ns1", []string{"ns1", "ns2"}},
+		{"empty entries", "ns1,,ns2,", []string{"ns1", "ns2"}},
+		{"sorted", "ns2,ns1", []string{"ns1", "ns2"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseNamespaces(tc.value); !reflect.DeepEqual(got, tc.expected) {
+				t.Errorf("parseNamespaces(%q) = %v, expected %v", tc.value, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestShardLeaderElectionID(t *testing.T) {
+	if got := shardLeaderElectionID(parseNamespaces("")); got != "f139389e.kuadrant.io" {
+		t.Errorf("expected the default leader election ID when watching all namespaces, got %q", got)
+	}
+
+	cases := []struct {
+		name string
+		a, b string
+		same bool
+	}{
+		{"same namespaces", "ns1,ns2", "ns1,ns2", true},
+		{"different order", "ns1,ns2", "ns2,ns1", true},
+		{"whitespace and duplicates", "ns1,ns2", " ns2 ,ns1,ns1", true},
+		{"different namespaces", "ns1,ns2", "ns1,ns3", false},
+		{"subset", "ns1,ns2", "ns1", false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			a := shardLeaderElectionID(parseNamespaces(tc.a))
+			b := shardLeaderElectionID(parseNamespaces(tc.b))
+			if (a == b) != tc.same {
+				t.Errorf("shardLeaderElectionID(%q) = %q, shardLeaderElectionID(%q) = %q, expected same: %t", tc.a, a, tc.b, b, tc.same)
+			}
+			for _, id := range []string{a, b} {
+				if id == leaderElectionID {
+					t.Errorf("expected a shard specific leader election ID, got %q", id)
+				}
+				// Leases are named after the leader election ID.
+				if errs := validation.IsDNS1123Subdomain(id); len(errs) > 0 {
+					t.Errorf("leader election ID %q is not a valid Lease name: %v", id, errs)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateLeaderElection(t *testing.T) {
+	cases := []struct {
+		name                                      string
+		leaseDuration, renewDeadline, retryPeriod time.Duration
+		valid                                     bool
+	}{
+		{"defaults", 15 * time.Second, 10 * time.Second, 2 * time.Second, true},
+		{"zero lease duration", 0, 10 * time.Second, 2 * time.Second, false},
+		{"negative retry period", 15 * time.Second, 10 * time.Second, -time.Second, false},
+		{"lease equal to renew deadline", 10 * time.Second, 10 * time.Second, 2 * time.Second, false},
+		{"renew deadline within jitter of retry period", 15 * time.Second, 10 * time.Second, 9 * time.Second, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateLeaderElection(tc.leaseDuration, tc.renewDeadline, tc.retryPeriod)
+			if (err == nil) != tc.valid {
+				t.Errorf("validateLeaderElection() error = %v, expected valid: %t", err, tc.valid)
+			}
+		})
+	}
+}
+
+func TestNewRateLimiterDefaults(t *testing.T) {
+	limiter := newRateLimiter(defaultRequeueBaseDelay, defaultRequeueMaxDelay, defaultRequeueQPS, defaultRequeueBurst)
+	expected := workqueue.DefaultControllerRateLimiter()
+
+	// Enough failures for the exponential backoff to reach the max delay,
+	// while staying within the token bucket burst.
+	var delay time.Duration
+	for i := 0; i < 25; i++ {
+		delay = limiter.When("item")
+		if want := expected.When("item"); delay != want {
+			t.Fatalf("failure %d: delay = %s, expected %s as with the default controller rate limiter", i+1, delay, want)
+		}
+		if i == 0 && delay != 5*time.Millisecond {
+			t.Errorf("first failure: delay = %s, expected 5ms", delay)
+		}
+	}
+	if delay != defaultRequeueMaxDelay {
+		t.Errorf("backoff delay = %s, expected it to be capped at %s", delay, defaultRequeueMaxDelay)
+	}
+}
+
+func TestNewRateLimiterSeparateInstances(t *testing.T) {
+	a := newRateLimiter(defaultRequeueBaseDelay, defaultRequeueMaxDelay, defaultRequeueQPS, defaultRequeueBurst)
+	b := newRateLimiter(defaultRequeueBaseDelay, defaultRequeueMaxDelay, defaultRequeueQPS, defaultRequeueBurst)
+	if a == b {
+		t.Fatal("expected newRateLimiter to return a new instance on every call")
+	}
+
+	for i := 0; i < 5; i++ {
+		a.When("item")
+	}
+	if got := b.NumRequeues("item"); got != 0 {
+		t.Errorf("second rate limiter NumRequeues = %d, expected 0", got)
+	}
+	if got := b.When("item"); got != defaultRequeueBaseDelay {
+		t.Errorf("second rate limiter first delay = %s, expected %s", got, defaultRequeueBaseDelay)
+	}
+}
+
+func TestValidateRateLimiter(t *testing.T) {
+	cases := []struct {
+		name                string
+		baseDelay, maxDelay time.Duration
+		qps                 float64
+		burst               int
+		valid               bool
+	}{
+		{"defaults", defaultRequeueBaseDelay, defaultRequeueMaxDelay, defaultRequeueQPS, defaultRequeueBurst, true},
+		{"base equal to max", time.Second, time.Second, 10, 100, true},
+		{"zero qps", defaultRequeueBaseDelay, defaultRequeueMaxDelay, 0, 100, false},
+		{"negative qps", defaultRequeueBaseDelay, defaultRequeueMaxDelay, -1, 100, false},
+		{"zero burst", defaultRequeueBaseDelay, defaultRequeueMaxDelay, 10, 0, false},
+		{"zero base delay", 0, defaultRequeueMaxDelay, 10, 100, false},
+		{"base greater than max", 2 * time.Second, time.Second, 10, 100, false},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := validateRateLimiter(tc.baseDelay, tc.maxDelay, tc.qps, tc.burst)
+			if (err == nil) != tc.valid {
+				t.Errorf("validateRateLimiter() error = %v, expected valid: %t", err, tc.valid)
+			}
+		})
+	}
+}